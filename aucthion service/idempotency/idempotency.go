@@ -0,0 +1,176 @@
+// Package idempotency caches handler responses by client-supplied
+// request key, so a retried request is answered from cache instead of
+// repeating whatever side effects it already caused.
+package idempotency
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a cached response stays valid for replay.
+const DefaultTTL = 24 * time.Hour
+
+// Entry is a cached handler response, keyed by Idempotency-Key.
+type Entry struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type record struct {
+	key       string
+	value     Entry
+	expiresAt time.Time
+}
+
+// call tracks a key's in-flight computation so concurrent requests
+// sharing that key wait for the one already running instead of each
+// starting their own.
+type call struct {
+	done  chan struct{}
+	entry Entry
+}
+
+// Store is a bounded, TTL-expiring LRU cache of idempotency keys to
+// the response they produced.
+type Store struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List // front = most recently used
+	calls    map[string]*call
+}
+
+// NewStore returns an empty store bounded to capacity entries, each
+// valid for ttl after it's written.
+func NewStore(capacity int, ttl time.Duration) *Store {
+	return &Store{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		calls:    make(map[string]*call),
+	}
+}
+
+// Get returns the cached entry for key, if present and not expired.
+func (s *Store) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return Entry{}, false
+	}
+
+	rec := el.Value.(*record)
+	if time.Now().After(rec.expiresAt) {
+		s.order.Remove(el)
+		delete(s.items, key)
+		return Entry{}, false
+	}
+
+	s.order.MoveToFront(el)
+	return rec.value, true
+}
+
+// Put caches value under key, evicting the least recently used entry
+// if the store is over capacity.
+func (s *Store) Put(key string, value Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putLocked(key, value)
+}
+
+func (s *Store) putLocked(key string, value Entry) {
+	if el, ok := s.items[key]; ok {
+		rec := el.Value.(*record)
+		rec.value = value
+		rec.expiresAt = time.Now().Add(s.ttl)
+		s.order.MoveToFront(el)
+		return
+	}
+
+	el := s.order.PushFront(&record{key: key, value: value, expiresAt: time.Now().Add(s.ttl)})
+	s.items[key] = el
+
+	if s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		if oldest != nil {
+			s.order.Remove(oldest)
+			delete(s.items, oldest.Value.(*record).key)
+		}
+	}
+}
+
+// Do returns the cached entry for key if one already exists. Otherwise
+// it runs fn and caches the result, but only once per key even when
+// called concurrently: a second caller arriving while the first is
+// still running fn blocks until that call finishes and shares its
+// result, rather than racing it to also run fn. This is what makes a
+// handler's Idempotency-Key handling safe against two genuinely
+// concurrent duplicate submissions (e.g. a client retry racing its own
+// original request), not just sequential ones.
+func (s *Store) Do(key string, fn func() Entry) Entry {
+	s.mu.Lock()
+	if el, ok := s.items[key]; ok {
+		rec := el.Value.(*record)
+		if time.Now().Before(rec.expiresAt) {
+			s.order.MoveToFront(el)
+			s.mu.Unlock()
+			return rec.value
+		}
+		s.order.Remove(el)
+		delete(s.items, key)
+	}
+
+	if c, ok := s.calls[key]; ok {
+		s.mu.Unlock()
+		<-c.done
+		return c.entry
+	}
+
+	c := &call{done: make(chan struct{})}
+	s.calls[key] = c
+	s.mu.Unlock()
+
+	// If fn panics, still remove the in-flight call and close c.done
+	// before propagating the panic, so waiters blocked on <-c.done don't
+	// hang forever. They get a 500 rather than fn's partial/zero-value
+	// result, since that result was never actually produced. Nothing is
+	// cached in that case, so the next caller with this key starts a
+	// fresh call rather than replaying a panic.
+	var entry Entry
+	defer func() {
+		r := recover()
+
+		waiterEntry := entry
+		if r != nil {
+			waiterEntry = Entry{Status: statusInternalServerError}
+		}
+
+		s.mu.Lock()
+		delete(s.calls, key)
+		if r == nil {
+			s.putLocked(key, entry)
+		}
+		s.mu.Unlock()
+
+		c.entry = waiterEntry
+		close(c.done)
+
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	entry = fn()
+	return entry
+}
+
+// statusInternalServerError mirrors net/http.StatusInternalServerError
+// without importing net/http into this package.
+const statusInternalServerError = 500
@@ -3,62 +3,172 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
 	"sync"
 	"time"
-	"log"
-	"io"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"auctionservice/idempotency"
+	"auctionservice/pubsub"
+	"auctionservice/storage"
+)
+
+const (
+	// AuctionTypeEnglish is the default open-outcry auction mode.
+	AuctionTypeEnglish = "english"
+	// AuctionTypeSealed is the commit/reveal sealed-bid mode.
+	AuctionTypeSealed = "sealed"
+
+	// defaultMinDepositPct is used when a sealed auction is created
+	// without an explicit MinDeposit, as a fraction of StartBid.
+	defaultMinDepositPct = 0.1
+
+	// idempotencyCapacity bounds how many distinct Idempotency-Key
+	// responses are cached at once.
+	idempotencyCapacity = 10000
+
+	// defaultSQLDriver and defaultSQLDSN back STORAGE_BACKEND=sql out
+	// of the box: a local SQLite file needs no external database to
+	// reach a working persistent backend. STORAGE_SQL_DRIVER/
+	// STORAGE_DSN override them; only the sqlite3 driver is imported
+	// here, and the SQL repository's queries use SQLite syntax.
+	defaultSQLDriver = "sqlite3"
+	defaultSQLDSN    = "auctions.db"
 )
 
-type Auction struct {
-	ID        int       `json:"id"`
-	Item      string    `json:"item"`
-	SellerID  int       `json:"seller_id"`
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time"`
-	StartBid  float64   `json:"start_bid"`
-	CurrentBid float64 `json:"current_bid"`
-	BuyNow    float64   `json:"buy_now,omitempty"`
+// Auction and Bid are re-exported from storage so handlers and
+// request/response bodies can keep referring to them directly.
+type Auction = storage.Auction
+type Bid = storage.Bid
+
+type CreateAuctionRequest struct {
+	Item     string  `json:"item"`
+	SellerID int     `json:"seller_id"`
+	Duration int     `json:"duration"`
+	StartBid float64 `json:"start_bid"`
+	BuyNow   float64 `json:"buy_now,omitempty"`
+
+	AuctionType    string  `json:"auction_type,omitempty"`
+	CommitDuration int     `json:"commit_duration,omitempty"`
+	RevealDuration int     `json:"reveal_duration,omitempty"`
+	MinDeposit     float64 `json:"min_deposit,omitempty"`
+
+	MinIncrement    float64       `json:"min_increment,omitempty"`
+	MinIncrementPct float64       `json:"min_increment_pct,omitempty"`
+	AntiSnipeWindow time.Duration `json:"anti_snipe_window,omitempty"`
 }
 
-type Bid struct {
-	UserID    int       `json:"user_id"`
-	AuctionID int       `json:"auction_id"`
-	Amount    float64   `json:"amount"`
-	Timestamp time.Time `json:"timestamp"`
+// sealedCommit tracks one bidder's commit/reveal state for a sealed-bid
+// auction. Amount and Revealed are only populated once the bidder
+// reveals. Commits aren't part of AuctionRepository: they're ephemeral
+// coordination state for a single auction's reveal window, not
+// something a restart needs to recover.
+type sealedCommit struct {
+	Hash     string
+	Deposit  float64
+	Revealed bool
+	Amount   float64
 }
 
-type CreateAuctionRequest struct {
-	Item      string    `json:"item"`
-	SellerID  int       `json:"seller_id"`
-	Duration  int       `json:"duration"` 
-	StartBid  float64   `json:"start_bid"`
-	BuyNow    float64   `json:"buy_now,omitempty"`
+// CommitRequest is the payload for POST /auctions/commit.
+type CommitRequest struct {
+	AuctionID  int    `json:"auction_id"`
+	UserID     int    `json:"user_id"`
+	CommitHash string `json:"commit_hash"`
+}
+
+// RevealRequest is the payload for POST /auctions/reveal.
+type RevealRequest struct {
+	AuctionID int     `json:"auction_id"`
+	UserID    int     `json:"user_id"`
+	Amount    float64 `json:"amount"`
+	Nonce     string  `json:"nonce"`
 }
 
 var (
-	auctions   = make(map[int]Auction)
-	bids       = make(map[int][]Bid)
-	auctionMutex sync.RWMutex
-	nextAuctionID = 1
+	// repo is the active AuctionRepository, selected once in main by
+	// STORAGE_BACKEND. Handlers never touch storage state directly.
+	repo storage.AuctionRepository
+
+	sealedCommits = make(map[int]map[int]*sealedCommit)
+	sealedMutex   sync.Mutex
+
+	// buyNowSignals wakes an auction's settlement goroutine early when
+	// a bid triggers its BuyNow short-circuit, instead of leaving it
+	// asleep until the auction's original EndTime. Buffered by 1 so a
+	// trigger is never lost even if the goroutine isn't selecting yet.
+	buyNowSignals = make(map[int]chan struct{})
+	buyNowMutex   sync.Mutex
+
+	// bidIdempotency caches placeBidHandler's response per
+	// Idempotency-Key, so a retried bid submission is answered without
+	// placing (or rejecting) the bid twice.
+	bidIdempotency = idempotency.NewStore(idempotencyCapacity, idempotency.DefaultTTL)
 )
 
+// errBidSuperseded signals that an auction's current bid changed
+// between when a handler validated a request and when it tried to
+// commit the result, so the bid must be rejected rather than overwrite
+// a newer one.
+var errBidSuperseded = errors.New("auction was updated concurrently")
+
 func main() {
-	auctionMutex.Lock()
-	nextAuctionID = 1
-	auctionMutex.Unlock()
+	repo = newRepository()
 
 	http.HandleFunc("/auctions", createAuctionHandler)
 	http.HandleFunc("/auctions/all", getAllAuctionsHandler)
 	http.HandleFunc("/auctions/bid", placeBidHandler)
 	http.HandleFunc("/auctions/list", listAuctionsHandler)
-	
+	http.HandleFunc("/auctions/commit", commitBidHandler)
+	http.HandleFunc("/auctions/reveal", revealBidHandler)
+	http.HandleFunc("/auctions/", auctionStreamHandler)
+
 	fmt.Println("Auction Service started on :8081")
 	http.ListenAndServe(":8081", nil)
 }
 
+// newRepository builds the AuctionRepository selected by
+// STORAGE_BACKEND: "sql" opens STORAGE_DSN with the driver named by
+// STORAGE_SQL_DRIVER (which must have been imported for its side
+// effect elsewhere in the build), anything else (including unset)
+// keeps today's in-memory behavior.
+func newRepository() storage.AuctionRepository {
+	if os.Getenv("STORAGE_BACKEND") != "sql" {
+		return storage.NewMemoryAuctionRepository()
+	}
+
+	driver := os.Getenv("STORAGE_SQL_DRIVER")
+	if driver == "" {
+		driver = defaultSQLDriver
+	}
+	dsn := os.Getenv("STORAGE_DSN")
+	if dsn == "" {
+		dsn = defaultSQLDSN
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		log.Fatalf("opening %s database: %v", driver, err)
+	}
+
+	sqlRepo, err := storage.NewSQLAuctionRepository(db)
+	if err != nil {
+		log.Fatalf("initializing SQL auction repository: %v", err)
+	}
+
+	return sqlRepo
+}
+
 func createAuctionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -79,26 +189,65 @@ func createAuctionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer resp.Body.Close()
 
-	auctionMutex.Lock()
-	defer auctionMutex.Unlock()
+	auctionType := req.AuctionType
+	if auctionType == "" {
+		auctionType = AuctionTypeEnglish
+	}
+	if auctionType != AuctionTypeEnglish && auctionType != AuctionTypeSealed {
+		http.Error(w, "Invalid auction_type", http.StatusBadRequest)
+		return
+	}
 
+	now := time.Now()
 	newAuction := Auction{
-		ID:        nextAuctionID,
-		Item:      req.Item,
-		SellerID:  req.SellerID,
-		StartTime: time.Now(),
-		EndTime:   time.Now().Add(time.Duration(req.Duration) * time.Hour),
-		StartBid:  req.StartBid,
-		CurrentBid: req.StartBid,
-		BuyNow:    req.BuyNow,
+		Item:            req.Item,
+		SellerID:        req.SellerID,
+		StartTime:       now,
+		EndTime:         now.Add(time.Duration(req.Duration) * time.Hour),
+		StartBid:        req.StartBid,
+		CurrentBid:      req.StartBid,
+		BuyNow:          req.BuyNow,
+		AuctionType:     auctionType,
+		MinIncrement:    req.MinIncrement,
+		MinIncrementPct: req.MinIncrementPct,
+		AntiSnipeWindow: req.AntiSnipeWindow,
 	}
 
-	auctions[nextAuctionID] = newAuction
-	nextAuctionID++
+	if auctionType == AuctionTypeSealed {
+		minDeposit := req.MinDeposit
+		if minDeposit <= 0 {
+			minDeposit = req.StartBid * defaultMinDepositPct
+		}
+		newAuction.MinDeposit = minDeposit
+		newAuction.CommitEndTime = now.Add(time.Duration(req.CommitDuration) * time.Hour)
+		newAuction.RevealEndTime = newAuction.CommitEndTime.Add(time.Duration(req.RevealDuration) * time.Hour)
+	}
+
+	created, err := repo.CreateAuction(newAuction)
+	if err != nil {
+		log.Printf("Error creating auction: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	settleAt := created.EndTime
+
+	if auctionType == AuctionTypeSealed {
+		sealedMutex.Lock()
+		sealedCommits[created.ID] = make(map[int]*sealedCommit)
+		sealedMutex.Unlock()
+		settleAt = created.RevealEndTime
+	} else {
+		buyNowMutex.Lock()
+		buyNowSignals[created.ID] = make(chan struct{}, 1)
+		buyNowMutex.Unlock()
+	}
+
+	go settleAuction(created.ID, settleAt)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(newAuction)
+	json.NewEncoder(w).Encode(created)
 }
 
 func getAllAuctionsHandler(w http.ResponseWriter, r *http.Request) {
@@ -107,39 +256,67 @@ func getAllAuctionsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	auctionMutex.RLock()
-	defer auctionMutex.RUnlock()
-
-	auctionList := make([]Auction, 0, len(auctions))
-	for _, auction := range auctions {
-		auctionList = append(auctionList, auction)
+	auctionList, err := repo.ListAuctions()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if auctionList == nil {
+		auctionList = []Auction{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(auctionList)
 }
 
+// placeBidHandler enforces the Idempotency-Key contract around placeBid:
+// a request carrying a key that's already cached is answered from cache
+// without placeBid running again, and concurrent requests sharing a key
+// share a single placeBid call via bidIdempotency.Do, so a client retry
+// after a dropped response (even one racing its own original request)
+// never double-bids or double-charges escrow.
 func placeBidHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		placeBid(w, r)
+		return
+	}
+
+	entry := bidIdempotency.Do(key, func() idempotency.Entry {
+		rec := newResponseRecorder()
+		placeBid(rec, r)
+		return rec.entry()
+	})
+	writeCachedResponse(w, entry)
+}
+
+func placeBid(w http.ResponseWriter, r *http.Request) {
 	var newBid Bid
 	if err := json.NewDecoder(r.Body).Decode(&newBid); err != nil {
 		http.Error(w, "Invalid bid data", http.StatusBadRequest)
 		return
 	}
 
-	auctionMutex.RLock()
-	auction, exists := auctions[newBid.AuctionID]
-	auctionMutex.RUnlock()
-
+	auction, exists, err := repo.GetAuction(newBid.AuctionID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 	if !exists {
 		http.Error(w, "Auction not found", http.StatusNotFound)
 		return
 	}
 
+	if auction.AuctionType == AuctionTypeSealed {
+		http.Error(w, "Sealed-bid auctions require /auctions/commit and /auctions/reveal", http.StatusBadRequest)
+		return
+	}
+
 	if time.Now().After(auction.EndTime) {
 		http.Error(w, "Auction has ended", http.StatusForbidden)
 		return
@@ -150,90 +327,85 @@ func placeBidHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	balanceCheckURL := fmt.Sprintf(
-		"http://localhost:8080/users/check_balance?user_id=%d&amount=%f",
-		newBid.UserID,
-		newBid.Amount,
-	)
-	
-	resp, err := http.Get(balanceCheckURL)
-	if err != nil {
+	minIncrement := auction.MinIncrement
+	if pctIncrement := auction.CurrentBid * auction.MinIncrementPct; pctIncrement > minIncrement {
+		minIncrement = pctIncrement
+	}
+	if newBid.Amount < auction.CurrentBid+minIncrement {
+		http.Error(w, "Bid does not meet the minimum increment", http.StatusBadRequest)
+		return
+	}
+
+	buyNow := auction.BuyNow > 0 && newBid.Amount >= auction.BuyNow
+
+	log.Printf("Escrowing %.2f from user %d for auction %d", newBid.Amount, newBid.UserID, newBid.AuctionID)
+
+	if err := escrowHold(newBid.UserID, newBid.Amount); err != nil {
+		log.Printf("Error holding escrow: %v", err)
+		if herr, ok := err.(*httpStatusError); ok && herr.status == http.StatusPaymentRequired {
+			http.Error(w, "Insufficient funds", http.StatusPaymentRequired)
+			return
+		}
 		http.Error(w, "User service unavailable", http.StatusServiceUnavailable)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		http.Error(w, "Failed to check user balance", http.StatusInternalServerError)
-		return
-	}
-
-	var balanceResponse struct {
-		CanBid  bool    `json:"canBid"`
-		Balance float64 `json:"balance"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&balanceResponse); err != nil {
-		http.Error(w, "Invalid balance response", http.StatusInternalServerError)
-		return
-	}
-
-	if !balanceResponse.CanBid {
-		http.Error(w, "Insufficient funds", http.StatusPaymentRequired)
-		return
-	}
-
-	updateURL := "http://localhost:8080/users/update_balance"
-    updateData := map[string]interface{}{
-        "user_id": newBid.UserID,
-        "amount": -newBid.Amount,
-    }
-    
-    jsonData, err := json.Marshal(updateData)
-    if err != nil {
-        log.Printf("Error marshaling update data: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
-        return
-    }
-
-    log.Printf("Deducting %.2f from user %d", newBid.Amount, newBid.UserID)
-    
-    req, err := http.NewRequest("PUT", updateURL, bytes.NewBuffer(jsonData))
-    if err != nil {
-        log.Printf("Error creating request: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
-        return
-    }
-    req.Header.Set("Content-Type", "application/json")
-
-    client := &http.Client{Timeout: 5 * time.Second}
-    respUpdate, err := client.Do(req)
-    if err != nil {
-        log.Printf("Error sending update request: %v", err)
-        http.Error(w, "User service unavailable", http.StatusServiceUnavailable)
-        return
-    }
-    defer respUpdate.Body.Close()
-
-    if respUpdate.StatusCode != http.StatusOK {
-        body, _ := io.ReadAll(respUpdate.Body)
-        log.Printf("Failed to deduct balance: status %d, response: %s", 
-            respUpdate.StatusCode, string(body))
-        http.Error(w, "Failed to deduct user balance", http.StatusInternalServerError)
-        return
-    }
-
-    if respUpdate.StatusCode != http.StatusOK {
-        http.Error(w, "Failed to deduct user balance", http.StatusInternalServerError)
-        return
-    }
-
-	auctionMutex.Lock()
-	auction.CurrentBid = newBid.Amount
-	auctions[newBid.AuctionID] = auction
+	prevBidderID := auction.CurrentBidderID
+	prevBidAmount := auction.CurrentBid
+
 	newBid.Timestamp = time.Now()
-	bids[newBid.AuctionID] = append(bids[newBid.AuctionID], newBid)
-	auctionMutex.Unlock()
+
+	var extended bool
+
+	updated, err := repo.UpdateAuctionAtomic(newBid.AuctionID, func(a Auction) (Auction, error) {
+		if a.CurrentBid != prevBidAmount || a.CurrentBidderID != prevBidderID {
+			return Auction{}, errBidSuperseded
+		}
+		a.CurrentBid = newBid.Amount
+		a.CurrentBidderID = newBid.UserID
+
+		switch {
+		case buyNow:
+			a.EndTime = time.Now()
+		case a.AntiSnipeWindow > 0 && time.Until(a.EndTime) < a.AntiSnipeWindow:
+			a.EndTime = a.EndTime.Add(a.AntiSnipeWindow)
+			extended = true
+		}
+
+		return a, nil
+	})
+	if err != nil {
+		if releaseErr := escrowRelease(newBid.UserID, newBid.Amount); releaseErr != nil {
+			log.Printf("Error releasing escrow after failed bid: %v", releaseErr)
+		}
+		if err == errBidSuperseded {
+			http.Error(w, "Bid was superseded by a concurrent bid", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if prevBidderID != 0 {
+		if err := escrowRelease(prevBidderID, prevBidAmount); err != nil {
+			log.Printf("Error releasing previous bidder's escrow: %v", err)
+		}
+	}
+
+	if err := repo.AppendBid(newBid.AuctionID, newBid); err != nil {
+		log.Printf("Error recording bid: %v", err)
+	}
+
+	liveFeed.Publish(newBid.AuctionID, pubsub.Message{Type: pubsub.EventBid, Data: newBid})
+	liveFeed.Publish(newBid.AuctionID, pubsub.Message{Type: pubsub.EventCurrentBid, Data: updated})
+
+	switch {
+	case buyNow:
+		liveFeed.Publish(newBid.AuctionID, pubsub.Message{Type: pubsub.EventBuyNowClosed, Data: updated})
+		triggerBuyNow(newBid.AuctionID)
+	case extended:
+		liveFeed.Publish(newBid.AuctionID, pubsub.Message{Type: pubsub.EventExtended, Data: updated})
+	}
 
 	response := struct {
 		Status  string  `json:"status"`
@@ -255,11 +427,14 @@ func listAuctionsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	auctionMutex.RLock()
-	defer auctionMutex.RUnlock()
+	auctionList, err := repo.ListAuctions()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	activeAuctions := []Auction{}
-	for _, auction := range auctions {
+	for _, auction := range auctionList {
 		if time.Now().Before(auction.EndTime) {
 			activeAuctions = append(activeAuctions, auction)
 		}
@@ -267,4 +442,426 @@ func listAuctionsHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(activeAuctions)
-}
\ No newline at end of file
+}
+
+// commitBidHandler accepts a sealed bidder's commitment hash and escrows
+// the auction's minimum deposit against them. The real bid amount stays
+// hidden until /auctions/reveal.
+func commitBidHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CommitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid commit data", http.StatusBadRequest)
+		return
+	}
+
+	auction, exists, err := repo.GetAuction(req.AuctionID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Auction not found", http.StatusNotFound)
+		return
+	}
+
+	if auction.AuctionType != AuctionTypeSealed {
+		http.Error(w, "Auction is not a sealed-bid auction", http.StatusBadRequest)
+		return
+	}
+
+	if time.Now().After(auction.CommitEndTime) {
+		http.Error(w, "Commit phase has ended", http.StatusForbidden)
+		return
+	}
+
+	if err := escrowHold(req.UserID, auction.MinDeposit); err != nil {
+		log.Printf("Error holding deposit: %v", err)
+		if herr, ok := err.(*httpStatusError); ok && herr.status == http.StatusPaymentRequired {
+			http.Error(w, "Insufficient funds for deposit", http.StatusPaymentRequired)
+			return
+		}
+		http.Error(w, "User service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	sealedMutex.Lock()
+	commits, ok := sealedCommits[req.AuctionID]
+	if !ok {
+		commits = make(map[int]*sealedCommit)
+		sealedCommits[req.AuctionID] = commits
+	}
+	if _, alreadyCommitted := commits[req.UserID]; alreadyCommitted {
+		sealedMutex.Unlock()
+		if err := escrowRelease(req.UserID, auction.MinDeposit); err != nil {
+			log.Printf("Error releasing duplicate deposit: %v", err)
+		}
+		http.Error(w, "User has already committed", http.StatusConflict)
+		return
+	}
+	commits[req.UserID] = &sealedCommit{Hash: req.CommitHash, Deposit: auction.MinDeposit}
+	sealedMutex.Unlock()
+
+	response := struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{
+		Status:  "success",
+		Message: "Commit accepted",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// revealBidHandler verifies a revealed bid against its stored commit
+// hash, escrows the real bid amount, and releases the deposit hold.
+func revealBidHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RevealRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid reveal data", http.StatusBadRequest)
+		return
+	}
+
+	auction, exists, err := repo.GetAuction(req.AuctionID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Auction not found", http.StatusNotFound)
+		return
+	}
+
+	if auction.AuctionType != AuctionTypeSealed {
+		http.Error(w, "Auction is not a sealed-bid auction", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if now.Before(auction.CommitEndTime) {
+		http.Error(w, "Commit phase is still open", http.StatusForbidden)
+		return
+	}
+	if now.After(auction.RevealEndTime) {
+		http.Error(w, "Reveal phase has ended", http.StatusForbidden)
+		return
+	}
+
+	if req.Amount < auction.StartBid {
+		http.Error(w, "Bid must meet the starting bid", http.StatusBadRequest)
+		return
+	}
+
+	sealedMutex.Lock()
+	commits := sealedCommits[req.AuctionID]
+	commit, ok := commits[req.UserID]
+	if !ok {
+		sealedMutex.Unlock()
+		http.Error(w, "No commit found for user", http.StatusNotFound)
+		return
+	}
+	if commit.Revealed {
+		sealedMutex.Unlock()
+		http.Error(w, "Bid already revealed", http.StatusConflict)
+		return
+	}
+	if computeCommitHash(req.Amount, req.Nonce, req.UserID) != commit.Hash {
+		sealedMutex.Unlock()
+		http.Error(w, "Commit hash mismatch", http.StatusBadRequest)
+		return
+	}
+	deposit := commit.Deposit
+	sealedMutex.Unlock()
+
+	// Release the commit-phase deposit before holding the revealed
+	// amount: HoldBalance only checks spendable Balance, not
+	// Balance+Escrowed, so a bidder whose true funds cover the reveal
+	// only because the deposit counts toward it would be spuriously
+	// rejected if the hold ran first.
+	if err := escrowRelease(req.UserID, deposit); err != nil {
+		log.Printf("Error releasing deposit before reveal: %v", err)
+		http.Error(w, "User service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := escrowHold(req.UserID, req.Amount); err != nil {
+		log.Printf("Error holding revealed bid: %v", err)
+		if reholdErr := escrowHold(req.UserID, deposit); reholdErr != nil {
+			log.Printf("Error restoring deposit hold after failed reveal: %v", reholdErr)
+		}
+		if herr, ok := err.(*httpStatusError); ok && herr.status == http.StatusPaymentRequired {
+			http.Error(w, "Insufficient funds to back revealed bid", http.StatusPaymentRequired)
+			return
+		}
+		http.Error(w, "User service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	sealedMutex.Lock()
+	commit.Revealed = true
+	commit.Amount = req.Amount
+	sealedMutex.Unlock()
+
+	if err := repo.AppendBid(req.AuctionID, Bid{
+		UserID:    req.UserID,
+		AuctionID: req.AuctionID,
+		Amount:    req.Amount,
+		Timestamp: time.Now(),
+	}); err != nil {
+		log.Printf("Error recording revealed bid: %v", err)
+	}
+
+	response := struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{
+		Status:  "success",
+		Message: "Bid revealed",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// computeCommitHash reproduces the client-side commitment formula,
+// sha256(amount || nonce || user_id), as a hex string.
+func computeCommitHash(amount float64, nonce string, userID int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%f%s%d", amount, nonce, userID)))
+	return hex.EncodeToString(sum[:])
+}
+
+// triggerBuyNow wakes auctionID's settlement goroutine immediately
+// instead of leaving it asleep until the auction's original EndTime.
+// It's a no-op if the auction has no registered signal (sealed
+// auctions, or a stale ID).
+func triggerBuyNow(auctionID int) {
+	buyNowMutex.Lock()
+	ch := buyNowSignals[auctionID]
+	buyNowMutex.Unlock()
+
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// httpStatusError carries the status code of a failed call to the user
+// service so callers can branch on it (e.g. payment-required vs. down).
+type httpStatusError struct {
+	status int
+	body   string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("user service returned status %d: %s", e.status, e.body)
+}
+
+// responseRecorder buffers a handler's response so it can be cached
+// against its Idempotency-Key before being written to the real
+// http.ResponseWriter.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (rec *responseRecorder) Header() http.Header { return rec.header }
+
+func (rec *responseRecorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+
+func (rec *responseRecorder) WriteHeader(status int) { rec.status = status }
+
+func (rec *responseRecorder) entry() idempotency.Entry {
+	return idempotency.Entry{
+		Status:      rec.status,
+		ContentType: rec.header.Get("Content-Type"),
+		Body:        rec.body.Bytes(),
+	}
+}
+
+// writeCachedResponse replays a cached handler response verbatim.
+func writeCachedResponse(w http.ResponseWriter, entry idempotency.Entry) {
+	if entry.ContentType != "" {
+		w.Header().Set("Content-Type", entry.ContentType)
+	}
+	w.WriteHeader(entry.Status)
+	w.Write(entry.Body)
+}
+
+// escrowHold moves amount out of a user's spendable balance and into
+// escrow to back a bid.
+func escrowHold(userID int, amount float64) error {
+	return postEscrow("/users/escrow/hold", map[string]interface{}{
+		"user_id": userID,
+		"amount":  amount,
+	})
+}
+
+// escrowRelease returns a previously held amount to a user's spendable
+// balance, used when they are outbid.
+func escrowRelease(userID int, amount float64) error {
+	return postEscrow("/users/escrow/release", map[string]interface{}{
+		"user_id": userID,
+		"amount":  amount,
+	})
+}
+
+// escrowCapture moves a winning bidder's held funds into the seller's
+// balance at auction settlement.
+func escrowCapture(bidderID, sellerID int, amount float64) error {
+	return postEscrow("/users/escrow/capture", map[string]interface{}{
+		"user_id":   bidderID,
+		"seller_id": sellerID,
+		"amount":    amount,
+	})
+}
+
+func postEscrow(path string, payload map[string]interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post("http://localhost:8080"+path, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &httpStatusError{status: resp.StatusCode, body: string(body)}
+	}
+
+	return nil
+}
+
+// settleAuction waits until settleAt and then closes out the auction:
+// for English auctions it captures the current high bidder's escrow
+// into the seller's balance; for sealed auctions it picks the highest
+// revealed bid as the winner and slashes no-show deposits. It runs once
+// per auction as a background goroutine started at creation time.
+func settleAuction(auctionID int, settleAt time.Time) {
+	buyNowMutex.Lock()
+	wake := buyNowSignals[auctionID]
+	buyNowMutex.Unlock()
+
+	// English auctions can have their EndTime pushed out by anti-snipe
+	// extensions, or pulled in by a BuyNow close, after this goroutine
+	// started waiting. Re-check EndTime each time we wake instead of
+	// trusting the value captured when the auction was created.
+	for {
+		if wait := time.Until(settleAt); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-wake:
+				timer.Stop()
+			}
+		}
+
+		auction, exists, err := repo.GetAuction(auctionID)
+		if err != nil || !exists {
+			return
+		}
+
+		if auction.AuctionType == AuctionTypeSealed {
+			settleSealedAuction(auctionID, auction.SellerID)
+			return
+		}
+
+		if time.Now().Before(auction.EndTime) {
+			settleAt = auction.EndTime
+			continue
+		}
+
+		if auction.CurrentBidderID == 0 {
+			liveFeed.Publish(auctionID, pubsub.Message{Type: pubsub.EventAuctionEnd, Data: auction})
+			return
+		}
+
+		if err := escrowCapture(auction.CurrentBidderID, auction.SellerID, auction.CurrentBid); err != nil {
+			log.Printf("Error settling auction %d: %v", auctionID, err)
+		}
+
+		liveFeed.Publish(auctionID, pubsub.Message{Type: pubsub.EventAuctionEnd, Data: auction})
+		return
+	}
+}
+
+// settleSealedAuction picks the highest revealed bid as the winner,
+// captures its escrow into the seller's balance, refunds losing
+// revealed bidders, and slashes the deposits of committers who never
+// revealed.
+func settleSealedAuction(auctionID, sellerID int) {
+	sealedMutex.Lock()
+	commits := sealedCommits[auctionID]
+	entries := make([]sealedCommit, 0, len(commits))
+	userIDs := make([]int, 0, len(commits))
+	for userID, c := range commits {
+		entries = append(entries, *c)
+		userIDs = append(userIDs, userID)
+	}
+	sealedMutex.Unlock()
+
+	winnerIdx := -1
+	for i, e := range entries {
+		if e.Revealed && (winnerIdx == -1 || e.Amount > entries[winnerIdx].Amount) {
+			winnerIdx = i
+		}
+	}
+
+	for i, e := range entries {
+		userID := userIDs[i]
+		switch {
+		case !e.Revealed:
+			if err := escrowCapture(userID, sellerID, e.Deposit); err != nil {
+				log.Printf("Error slashing deposit for user %d on auction %d: %v", userID, auctionID, err)
+			}
+		case i == winnerIdx:
+			if err := escrowCapture(userID, sellerID, e.Amount); err != nil {
+				log.Printf("Error capturing winning bid for user %d on auction %d: %v", userID, auctionID, err)
+			}
+		default:
+			if err := escrowRelease(userID, e.Amount); err != nil {
+				log.Printf("Error refunding losing bidder %d on auction %d: %v", userID, auctionID, err)
+			}
+		}
+	}
+
+	var finalAuction Auction
+
+	if winnerIdx != -1 {
+		updated, err := repo.UpdateAuctionAtomic(auctionID, func(a Auction) (Auction, error) {
+			a.CurrentBid = entries[winnerIdx].Amount
+			a.CurrentBidderID = userIDs[winnerIdx]
+			return a, nil
+		})
+		if err != nil {
+			log.Printf("Error recording sealed auction winner for auction %d: %v", auctionID, err)
+		}
+		finalAuction = updated
+	} else {
+		finalAuction, _, _ = repo.GetAuction(auctionID)
+	}
+
+	liveFeed.Publish(auctionID, pubsub.Message{Type: pubsub.EventAuctionEnd, Data: finalAuction})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"auctionservice/idempotency"
+	"auctionservice/storage"
+)
+
+// startFakeUserService stands in for the real user service's escrow
+// endpoints on 127.0.0.1:8080, which postEscrow's URL is hardcoded
+// against. It accepts every hold/release/capture call and tracks the
+// number of holds actually applied, so the test can assert escrow was
+// only ever debited once despite concurrent duplicate bid submissions.
+func startFakeUserService(t *testing.T) *int32 {
+	t.Helper()
+
+	var holds int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/escrow/hold", func(w http.ResponseWriter, r *http.Request) {
+		holds++
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/users/escrow/release", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/users/escrow/capture", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:8080")
+	if err != nil {
+		t.Skipf("cannot bind 127.0.0.1:8080 to stand in for the user service: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Listener.Close()
+	srv.Listener = listener
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return &holds
+}
+
+// TestPlaceBidHandlerDeduplicatesConcurrentRetries fires concurrent
+// duplicate POST /auctions/bid requests sharing an Idempotency-Key and
+// asserts the auction's bid list and current bid reflect exactly one
+// accepted bid, not one per request.
+func TestPlaceBidHandlerDeduplicatesConcurrentRetries(t *testing.T) {
+	holds := startFakeUserService(t)
+
+	repo = storage.NewMemoryAuctionRepository()
+	bidIdempotency = idempotency.NewStore(idempotencyCapacity, idempotency.DefaultTTL)
+
+	auction, err := repo.CreateAuction(storage.Auction{
+		Item:       "Guitar",
+		SellerID:   1,
+		StartBid:   100,
+		CurrentBid: 100,
+		EndTime:    time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreateAuction: %v", err)
+	}
+
+	const concurrency = 20
+	body := []byte(`{"user_id":2,"auction_id":` + strconv.Itoa(auction.ID) + `,"amount":150}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/auctions/bid", bytes.NewReader(body))
+			req.Header.Set("Idempotency-Key", "bid-retry-key")
+			rec := httptest.NewRecorder()
+			placeBidHandler(rec, req)
+		}()
+	}
+	wg.Wait()
+
+	updated, exists, err := repo.GetAuction(auction.ID)
+	if err != nil || !exists {
+		t.Fatalf("GetAuction after concurrent bids: exists=%v err=%v", exists, err)
+	}
+	if updated.CurrentBid != 150 || updated.CurrentBidderID != 2 {
+		t.Fatalf("expected exactly one accepted bid of 150 from user 2, got current_bid=%v current_bidder_id=%v", updated.CurrentBid, updated.CurrentBidderID)
+	}
+
+	bids, err := repo.ListBids(auction.ID)
+	if err != nil {
+		t.Fatalf("ListBids: %v", err)
+	}
+	if len(bids) != 1 {
+		t.Fatalf("expected exactly 1 recorded bid for %d concurrent duplicate submissions, got %d", concurrency, len(bids))
+	}
+
+	if *holds != 1 {
+		t.Fatalf("expected exactly 1 escrow hold for %d concurrent duplicate submissions, got %d", concurrency, *holds)
+	}
+}
@@ -0,0 +1,88 @@
+// Package pubsub fans out live auction events to subscribers (the
+// WebSocket and SSE streaming endpoints) without the publisher ever
+// blocking on a slow client.
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Event type constants used as Message.Type.
+const (
+	EventBid          = "bid"
+	EventCurrentBid   = "current_bid"
+	EventAuctionEnd   = "auction_end"
+	EventExtended     = "extended"
+	EventBuyNowClosed = "buy_now_closed"
+)
+
+// subscriberBuffer bounds how many unread messages a slow client can
+// accumulate before it is disconnected.
+const subscriberBuffer = 32
+
+// Message is one event pushed to subscribers of an auction's live feed.
+type Message struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Hub fans out auction events to per-auction subscriber channels, kept
+// in a sync.Map per auction ID since subscribers come and go far more
+// often than auctions do.
+type Hub struct {
+	auctions sync.Map // auctionID -> *sync.Map (subscriberID -> chan Message)
+	nextID   int64
+}
+
+// NewHub returns an empty Hub ready to use.
+func NewHub() *Hub {
+	return &Hub{}
+}
+
+func (h *Hub) subscribers(auctionID int) *sync.Map {
+	v, _ := h.auctions.LoadOrStore(auctionID, &sync.Map{})
+	return v.(*sync.Map)
+}
+
+// Subscribe registers a new subscriber for an auction's events and
+// returns the channel it will receive them on, plus a cancel func that
+// must be called when the subscriber disconnects.
+func (h *Hub) Subscribe(auctionID int) (ch <-chan Message, cancel func()) {
+	id := atomic.AddInt64(&h.nextID, 1)
+	c := make(chan Message, subscriberBuffer)
+	h.subscribers(auctionID).Store(id, c)
+
+	cancel = func() {
+		subs := h.subscribers(auctionID)
+		if v, ok := subs.LoadAndDelete(id); ok {
+			close(v.(chan Message))
+		}
+	}
+
+	return c, cancel
+}
+
+// Publish fans msg out to every current subscriber of auctionID. A
+// subscriber whose buffer is full is treated as a slow consumer: it is
+// dropped and its channel closed rather than letting it block the
+// publisher.
+func (h *Hub) Publish(auctionID int, msg Message) {
+	subs := h.subscribers(auctionID)
+	subs.Range(func(key, value interface{}) bool {
+		ch := value.(chan Message)
+		select {
+		case ch <- msg:
+		default:
+			// LoadAndDelete, not Delete: two concurrent Publish calls
+			// (or a Publish racing Subscribe's cancel) can both see this
+			// channel as full before either removes it. Only the one
+			// that actually wins the removal may close it, or both
+			// would close the same channel and panic.
+			if _, ok := subs.LoadAndDelete(key); ok {
+				close(ch)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,33 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestPublishConcurrentSlowConsumerEviction asserts that concurrent
+// Publish calls racing to evict the same full-buffer subscriber never
+// close its channel twice, which would panic the whole process since
+// settleAuction publishes from a bare goroutine with no recover.
+func TestPublishConcurrentSlowConsumerEviction(t *testing.T) {
+	h := NewHub()
+	ch, cancel := h.Subscribe(1)
+	defer cancel()
+
+	// Fill the subscriber's buffer so every Publish below takes the
+	// slow-consumer eviction path instead of delivering the message.
+	for i := 0; i < subscriberBuffer; i++ {
+		h.Publish(1, Message{Type: EventBid})
+	}
+	_ = ch
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.Publish(1, Message{Type: EventBid})
+		}()
+	}
+	wg.Wait()
+}
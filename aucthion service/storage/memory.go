@@ -0,0 +1,88 @@
+package storage
+
+import "sync"
+
+// MemoryAuctionRepository is the original in-process map-backed store,
+// wrapped behind AuctionRepository so it's a drop-in alternative to a
+// SQL backend. All state is lost on restart.
+type MemoryAuctionRepository struct {
+	mu            sync.Mutex
+	auctions      map[int]Auction
+	bids          map[int][]Bid
+	nextAuctionID int
+}
+
+// NewMemoryAuctionRepository returns an empty in-memory repository.
+func NewMemoryAuctionRepository() *MemoryAuctionRepository {
+	return &MemoryAuctionRepository{
+		auctions:      make(map[int]Auction),
+		bids:          make(map[int][]Bid),
+		nextAuctionID: 1,
+	}
+}
+
+func (r *MemoryAuctionRepository) CreateAuction(auction Auction) (Auction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	auction.ID = r.nextAuctionID
+	r.auctions[auction.ID] = auction
+	r.nextAuctionID++
+
+	return auction, nil
+}
+
+func (r *MemoryAuctionRepository) GetAuction(id int) (Auction, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	auction, exists := r.auctions[id]
+	return auction, exists, nil
+}
+
+func (r *MemoryAuctionRepository) ListAuctions() ([]Auction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Auction, 0, len(r.auctions))
+	for _, auction := range r.auctions {
+		list = append(list, auction)
+	}
+	return list, nil
+}
+
+func (r *MemoryAuctionRepository) UpdateAuctionAtomic(id int, fn func(Auction) (Auction, error)) (Auction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	auction, exists := r.auctions[id]
+	if !exists {
+		return Auction{}, ErrAuctionNotFound
+	}
+
+	updated, err := fn(auction)
+	if err != nil {
+		return Auction{}, err
+	}
+
+	r.auctions[id] = updated
+	return updated, nil
+}
+
+func (r *MemoryAuctionRepository) AppendBid(auctionID int, bid Bid) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bids[auctionID] = append(r.bids[auctionID], bid)
+	return nil
+}
+
+func (r *MemoryAuctionRepository) ListBids(auctionID int) ([]Bid, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bids := r.bids[auctionID]
+	out := make([]Bid, len(bids))
+	copy(out, bids)
+	return out, nil
+}
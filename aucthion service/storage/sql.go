@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLAuctionRepository is a database/sql-backed AuctionRepository over
+// an *sql.DB opened by the caller. Its schema and queries use SQLite
+// syntax (AUTOINCREMENT, "?" placeholders, LastInsertId), so drivers
+// for other SQL dialects such as Postgres do not work with it. This
+// package only depends on the standard library, so the driver itself
+// must be imported for its side effect wherever the binary selects
+// STORAGE_BACKEND=sql.
+type SQLAuctionRepository struct {
+	db *sql.DB
+}
+
+// NewSQLAuctionRepository wraps an already-opened *sql.DB and ensures
+// the auctions and bids tables exist.
+func NewSQLAuctionRepository(db *sql.DB) (*SQLAuctionRepository, error) {
+	const schema = `
+CREATE TABLE IF NOT EXISTS auctions (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	item              TEXT NOT NULL,
+	seller_id         INTEGER NOT NULL,
+	start_time        TEXT NOT NULL,
+	end_time          TEXT NOT NULL,
+	start_bid         REAL NOT NULL,
+	current_bid       REAL NOT NULL,
+	current_bidder_id INTEGER NOT NULL DEFAULT 0,
+	buy_now           REAL NOT NULL DEFAULT 0,
+	auction_type      TEXT NOT NULL DEFAULT 'english',
+	commit_end_time   TEXT,
+	reveal_end_time   TEXT,
+	min_deposit       REAL NOT NULL DEFAULT 0,
+	min_increment     REAL NOT NULL DEFAULT 0,
+	min_increment_pct REAL NOT NULL DEFAULT 0,
+	anti_snipe_window INTEGER NOT NULL DEFAULT 0,
+	version           INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS bids (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	auction_id INTEGER NOT NULL,
+	user_id    INTEGER NOT NULL,
+	amount     REAL NOT NULL,
+	timestamp  TEXT NOT NULL
+);`
+
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("creating auction tables: %w", err)
+	}
+
+	return &SQLAuctionRepository{db: db}, nil
+}
+
+func (r *SQLAuctionRepository) CreateAuction(auction Auction) (Auction, error) {
+	res, err := r.db.Exec(
+		`INSERT INTO auctions
+			(item, seller_id, start_time, end_time, start_bid, current_bid, current_bidder_id,
+			 buy_now, auction_type, commit_end_time, reveal_end_time, min_deposit,
+			 min_increment, min_increment_pct, anti_snipe_window)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		auction.Item, auction.SellerID, formatTime(auction.StartTime), formatTime(auction.EndTime),
+		auction.StartBid, auction.CurrentBid, auction.CurrentBidderID, auction.BuyNow,
+		auction.AuctionType, formatTime(auction.CommitEndTime), formatTime(auction.RevealEndTime),
+		auction.MinDeposit, auction.MinIncrement, auction.MinIncrementPct, int64(auction.AntiSnipeWindow),
+	)
+	if err != nil {
+		return Auction{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Auction{}, err
+	}
+
+	auction.ID = int(id)
+	return auction, nil
+}
+
+func (r *SQLAuctionRepository) GetAuction(id int) (Auction, bool, error) {
+	return scanAuction(r.db.QueryRow(
+		`SELECT id, item, seller_id, start_time, end_time, start_bid, current_bid,
+			current_bidder_id, buy_now, auction_type, commit_end_time, reveal_end_time, min_deposit,
+			min_increment, min_increment_pct, anti_snipe_window
+		 FROM auctions WHERE id = ?`, id,
+	))
+}
+
+func (r *SQLAuctionRepository) ListAuctions() ([]Auction, error) {
+	rows, err := r.db.Query(
+		`SELECT id, item, seller_id, start_time, end_time, start_bid, current_bid,
+			current_bidder_id, buy_now, auction_type, commit_end_time, reveal_end_time, min_deposit,
+			min_increment, min_increment_pct, anti_snipe_window
+		 FROM auctions`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var auctions []Auction
+	for rows.Next() {
+		auction, err := scanAuctionRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		auctions = append(auctions, auction)
+	}
+	return auctions, rows.Err()
+}
+
+// maxCASRetries bounds how many times UpdateAuctionAtomic retries
+// after losing a compare-and-swap race against another writer, before
+// giving up.
+const maxCASRetries = 10
+
+// UpdateAuctionAtomic loads the row alongside its version counter,
+// applies fn, and writes the result back gated on that version being
+// unchanged (`UPDATE ... WHERE id = ? AND version = ?`). A plain SELECT
+// then UPDATE inside a transaction is NOT enough on READ COMMITTED
+// engines like Postgres: two concurrent transactions can both read the
+// same row and both commit their write, silently losing one of them.
+// The version guard turns that lost update into a detectable
+// rows-affected-0, which we retry against a fresh read.
+func (r *SQLAuctionRepository) UpdateAuctionAtomic(id int, fn func(Auction) (Auction, error)) (Auction, error) {
+	for attempt := 0; attempt < maxCASRetries; attempt++ {
+		updated, ok, err := r.tryUpdateAuctionAtomic(id, fn)
+		if err != nil || ok {
+			return updated, err
+		}
+	}
+	return Auction{}, fmt.Errorf("auction %d: exceeded %d retries racing concurrent updates", id, maxCASRetries)
+}
+
+// tryUpdateAuctionAtomic makes one CAS attempt. ok is false only when
+// the version guard caught a concurrent writer, meaning the caller
+// should re-read and retry.
+func (r *SQLAuctionRepository) tryUpdateAuctionAtomic(id int, fn func(Auction) (Auction, error)) (_ Auction, ok bool, _ error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Auction{}, false, err
+	}
+	defer tx.Rollback()
+
+	var version int64
+	auction, found, err := scanAuction(tx.QueryRow(
+		`SELECT id, item, seller_id, start_time, end_time, start_bid, current_bid,
+			current_bidder_id, buy_now, auction_type, commit_end_time, reveal_end_time, min_deposit,
+			min_increment, min_increment_pct, anti_snipe_window, version
+		 FROM auctions WHERE id = ?`, id,
+	), &version)
+	if err != nil {
+		return Auction{}, false, err
+	}
+	if !found {
+		return Auction{}, false, ErrAuctionNotFound
+	}
+
+	updated, err := fn(auction)
+	if err != nil {
+		return Auction{}, false, err
+	}
+
+	res, err := tx.Exec(
+		`UPDATE auctions SET item = ?, seller_id = ?, start_time = ?, end_time = ?, start_bid = ?,
+			current_bid = ?, current_bidder_id = ?, buy_now = ?, auction_type = ?,
+			commit_end_time = ?, reveal_end_time = ?, min_deposit = ?,
+			min_increment = ?, min_increment_pct = ?, anti_snipe_window = ?, version = version + 1
+		 WHERE id = ? AND version = ?`,
+		updated.Item, updated.SellerID, formatTime(updated.StartTime), formatTime(updated.EndTime),
+		updated.StartBid, updated.CurrentBid, updated.CurrentBidderID, updated.BuyNow,
+		updated.AuctionType, formatTime(updated.CommitEndTime), formatTime(updated.RevealEndTime),
+		updated.MinDeposit, updated.MinIncrement, updated.MinIncrementPct, int64(updated.AntiSnipeWindow),
+		id, version,
+	)
+	if err != nil {
+		return Auction{}, false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return Auction{}, false, err
+	}
+	if rows == 0 {
+		return Auction{}, false, nil
+	}
+
+	return updated, true, tx.Commit()
+}
+
+func (r *SQLAuctionRepository) AppendBid(auctionID int, bid Bid) error {
+	_, err := r.db.Exec(
+		"INSERT INTO bids (auction_id, user_id, amount, timestamp) VALUES (?, ?, ?, ?)",
+		auctionID, bid.UserID, bid.Amount, formatTime(bid.Timestamp),
+	)
+	return err
+}
+
+func (r *SQLAuctionRepository) ListBids(auctionID int) ([]Bid, error) {
+	rows, err := r.db.Query(
+		"SELECT user_id, auction_id, amount, timestamp FROM bids WHERE auction_id = ? ORDER BY id",
+		auctionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bids []Bid
+	for rows.Next() {
+		var b Bid
+		var ts string
+		if err := rows.Scan(&b.UserID, &b.AuctionID, &b.Amount, &ts); err != nil {
+			return nil, err
+		}
+		b.Timestamp, _ = time.Parse(time.RFC3339Nano, ts)
+		bids = append(bids, b)
+	}
+	return bids, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAuction scans one auction row, reporting found=false instead of
+// an error when the row doesn't exist. extraDest, if given, receives
+// any columns selected after anti_snipe_window (e.g. version) in the
+// order they appear in the query.
+func scanAuction(row rowScanner, extraDest ...interface{}) (Auction, bool, error) {
+	auction, err := scanAuctionRow(row, extraDest...)
+	if err == sql.ErrNoRows {
+		return Auction{}, false, nil
+	}
+	if err != nil {
+		return Auction{}, false, err
+	}
+	return auction, true, nil
+}
+
+func scanAuctionRow(row rowScanner, extraDest ...interface{}) (Auction, error) {
+	var a Auction
+	var startTime, endTime, commitEndTime, reveaEndTime sql.NullString
+	var antiSnipeWindow int64
+
+	dest := []interface{}{
+		&a.ID, &a.Item, &a.SellerID, &startTime, &endTime, &a.StartBid, &a.CurrentBid,
+		&a.CurrentBidderID, &a.BuyNow, &a.AuctionType, &commitEndTime, &reveaEndTime, &a.MinDeposit,
+		&a.MinIncrement, &a.MinIncrementPct, &antiSnipeWindow,
+	}
+	dest = append(dest, extraDest...)
+
+	if err := row.Scan(dest...); err != nil {
+		return Auction{}, err
+	}
+
+	a.StartTime = parseTime(startTime.String)
+	a.EndTime = parseTime(endTime.String)
+	a.CommitEndTime = parseTime(commitEndTime.String)
+	a.RevealEndTime = parseTime(reveaEndTime.String)
+	a.AntiSnipeWindow = time.Duration(antiSnipeWindow)
+
+	return a, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
@@ -0,0 +1,70 @@
+// Package storage defines the persistence boundary for the Auction
+// Service. Handlers depend only on the AuctionRepository interface so
+// the backing store (in-memory today, a SQL database when
+// STORAGE_BACKEND asks for it) can be swapped without touching handler
+// code, and so "check current bid, update it" is a single atomic unit
+// (UpdateAuctionAtomic) rather than racing map accesses. Recording the
+// bid itself (AppendBid) is a separate call and is not part of that
+// unit.
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrAuctionNotFound = errors.New("auction not found")
+
+// Auction is the persisted auction record.
+type Auction struct {
+	ID              int       `json:"id"`
+	Item            string    `json:"item"`
+	SellerID        int       `json:"seller_id"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	StartBid        float64   `json:"start_bid"`
+	CurrentBid      float64   `json:"current_bid"`
+	CurrentBidderID int       `json:"current_bidder_id,omitempty"`
+	BuyNow          float64   `json:"buy_now,omitempty"`
+
+	AuctionType   string    `json:"auction_type"`
+	CommitEndTime time.Time `json:"commit_end_time,omitempty"`
+	RevealEndTime time.Time `json:"reveal_end_time,omitempty"`
+	MinDeposit    float64   `json:"min_deposit,omitempty"`
+
+	// MinIncrement and MinIncrementPct set the smallest amount a new
+	// bid must exceed the current bid by, as a flat amount and as a
+	// fraction of CurrentBid (0.05 means 5%); the larger of the two
+	// applies.
+	MinIncrement    float64 `json:"min_increment,omitempty"`
+	MinIncrementPct float64 `json:"min_increment_pct,omitempty"`
+	// AntiSnipeWindow, if set, extends EndTime by itself whenever a
+	// valid bid lands within that window of the close, so a "soft
+	// close" keeps pushing EndTime out until bidding goes quiet.
+	AntiSnipeWindow time.Duration `json:"anti_snipe_window,omitempty"`
+}
+
+// Bid is one accepted or revealed bid against an auction.
+type Bid struct {
+	UserID    int       `json:"user_id"`
+	AuctionID int       `json:"auction_id"`
+	Amount    float64   `json:"amount"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AuctionRepository is the full set of operations the Auction Service
+// needs against auctions and their bids.
+type AuctionRepository interface {
+	CreateAuction(auction Auction) (Auction, error)
+	GetAuction(id int) (Auction, bool, error)
+	ListAuctions() ([]Auction, error)
+
+	// UpdateAuctionAtomic loads the auction, applies fn, and saves the
+	// result as a single atomic unit, so read-modify-write sequences
+	// (accepting a bid, settling an auction) never race with a
+	// concurrent update of the same auction.
+	UpdateAuctionAtomic(id int, fn func(Auction) (Auction, error)) (Auction, error)
+
+	AppendBid(auctionID int, bid Bid) error
+	ListBids(auctionID int) ([]Bid, error)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"auctionservice/pubsub"
+)
+
+// liveFeed fans out bid/current-bid/auction-end events to every
+// streaming subscriber of an auction.
+var liveFeed = pubsub.NewHub()
+
+const heartbeatInterval = 15 * time.Second
+
+// websocketGUID is the fixed key-mixing suffix defined by RFC 6455.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// auctionStreamHandler serves both the WebSocket feed
+// (GET /auctions/{id}/stream) and the Server-Sent Events feed
+// (GET /auctions/{id}/events) for auctions not matched by the more
+// specific routes registered in main.
+func auctionStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/auctions/")
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	auctionID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid auction ID", http.StatusBadRequest)
+		return
+	}
+
+	_, exists, err := repo.GetAuction(auctionID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Auction not found", http.StatusNotFound)
+		return
+	}
+
+	switch parts[1] {
+	case "stream":
+		serveWebSocketStream(w, r, auctionID)
+	case "events":
+		serveEvents(w, r, auctionID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveEvents negotiates on the Accept header between a live
+// Server-Sent Events stream and a single JSON snapshot for clients that
+// asked for neither SSE nor a WebSocket.
+func serveEvents(w http.ResponseWriter, r *http.Request, auctionID int) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		auction, _, err := repo.GetAuction(auctionID)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(auction)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	msgs, cancel := liveFeed.Subscribe(auctionID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(msg)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serveWebSocketStream upgrades the connection and pushes every
+// subsequent auction event as a JSON text frame, with a 15s heartbeat
+// ping and a bounded per-client buffer (see pubsub.Hub) that drops slow
+// consumers instead of blocking publishers.
+func serveWebSocketStream(w http.ResponseWriter, r *http.Request, auctionID int) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		http.Error(w, "WebSocket upgrade failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer ws.Close()
+
+	msgs, cancel := liveFeed.Subscribe(auctionID)
+	defer cancel()
+
+	clientClosed := make(chan struct{})
+	go func() {
+		defer close(clientClosed)
+		for {
+			opcode, payload, err := ws.readFrame()
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsOpClose:
+				return
+			case wsOpPing:
+				ws.writeFrame(wsOpPong, payload)
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(msg)
+			if err := ws.writeFrame(wsOpText, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := ws.writeFrame(wsOpPing, nil); err != nil {
+				return
+			}
+		case <-clientClosed:
+			return
+		}
+	}
+}
+
+// Minimal RFC 6455 server implementation: just enough handshake and
+// framing to push JSON text frames and answer heartbeat pings, without
+// pulling in a WebSocket dependency for a one-directional feed.
+
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	// writeMu serializes writeFrame: the reader goroutine answers pings
+	// on this connection while the main select loop writes messages and
+	// heartbeats on it too, and both share the same bufio.ReadWriter.
+	writeMu sync.Mutex
+}
+
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return nil, fmt.Errorf("not a websocket upgrade request")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	accept := computeWebSocketAccept(key)
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + accept + "\r\n\r\n"
+
+	if _, err := rw.WriteString(response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, rw: rw}, nil
+}
+
+func computeWebSocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	var header [10]byte
+	header[0] = 0x80 | opcode
+
+	n := len(payload)
+	var headerLen int
+	switch {
+	case n <= 125:
+		header[1] = byte(n)
+		headerLen = 2
+	case n <= 65535:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:4], uint16(n))
+		headerLen = 4
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:10], uint64(n))
+		headerLen = 10
+	}
+
+	if _, err := c.rw.Write(header[:headerLen]); err != nil {
+		return err
+	}
+	if n > 0 {
+		if _, err := c.rw.Write(payload); err != nil {
+			return err
+		}
+	}
+	return c.rw.Flush()
+}
+
+// readFrame reads one client frame. Client frames are always masked
+// per RFC 6455, so the mask key is unmasked before the payload is
+// returned.
+func (c *wsConn) readFrame() (opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.rw, header[:]); err != nil {
+		return
+	}
+
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.rw, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.rw, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.rw, maskKey[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.rw, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= maskKey[i%4]
+		}
+	}
+
+	return
+}
@@ -0,0 +1,134 @@
+package idempotency
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDoSerializesConcurrentDuplicates asserts that concurrent callers
+// sharing the same Idempotency-Key only run the underlying handler
+// once, so two genuinely concurrent duplicate submissions (e.g. a
+// client retry racing its own original request) can never both debit a
+// user's balance.
+func TestDoSerializesConcurrentDuplicates(t *testing.T) {
+	store := NewStore(10, DefaultTTL)
+
+	var debits int32
+	const concurrency = 20
+
+	var wg sync.WaitGroup
+	results := make([]Entry, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = store.Do("retry-key", func() Entry {
+				atomic.AddInt32(&debits, 1)
+				return Entry{Status: 200, Body: []byte("debited")}
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	if debits != 1 {
+		t.Fatalf("expected exactly 1 debit for %d concurrent duplicate submissions, got %d", concurrency, debits)
+	}
+	for i, entry := range results {
+		if entry.Status != 200 || string(entry.Body) != "debited" {
+			t.Fatalf("result %d got unexpected entry: %+v", i, entry)
+		}
+	}
+}
+
+// TestDoRecoversFromPanic asserts that a call whose fn panics returns
+// rather than hanging, that the panic still propagates to the caller
+// that triggered it, and that nothing is cached so the next call with
+// the same key runs fn afresh.
+func TestDoRecoversFromPanic(t *testing.T) {
+	store := NewStore(10, DefaultTTL)
+
+	released := make(chan struct{})
+	var recovered interface{}
+	go func() {
+		defer func() {
+			recovered = recover()
+			close(released)
+		}()
+		store.Do("panic-key", func() Entry {
+			panic("boom")
+		})
+	}()
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("Do did not release its in-flight call after fn panicked")
+	}
+	if recovered == nil {
+		t.Fatal("the panic from fn did not propagate to Do's caller")
+	}
+
+	if _, ok := store.Get("panic-key"); ok {
+		t.Fatal("a panicking call must not cache a result")
+	}
+
+	entry := store.Do("panic-key", func() Entry {
+		return Entry{Status: 200, Body: []byte("ok")}
+	})
+	if entry.Status != 200 {
+		t.Fatalf("expected a fresh call to succeed after a prior panic, got %+v", entry)
+	}
+}
+
+// TestDoWaiterGetsErrorOnPanic asserts that a waiter released by a
+// panicking call gets a 500 response, not the zero-value Entry that
+// would make a handler call http.ResponseWriter.WriteHeader(0) and
+// crash the connection.
+func TestDoWaiterGetsErrorOnPanic(t *testing.T) {
+	store := NewStore(10, DefaultTTL)
+
+	fnStarted := make(chan struct{})
+	releaseFn := make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		store.Do("panic-key", func() Entry {
+			close(fnStarted)
+			<-releaseFn
+			panic("boom")
+		})
+	}()
+
+	<-fnStarted
+
+	var waiterEntry Entry
+	waiterDone := make(chan struct{})
+	waiterCalling := make(chan struct{})
+	go func() {
+		defer close(waiterDone)
+		close(waiterCalling)
+		waiterEntry = store.Do("panic-key", func() Entry {
+			t.Error("waiter must not run fn itself")
+			return Entry{}
+		})
+	}()
+
+	// Give the waiter goroutine a chance to see the in-flight call and
+	// block on c.done before we let it panic out from under it.
+	<-waiterCalling
+	time.Sleep(20 * time.Millisecond)
+
+	close(releaseFn)
+
+	select {
+	case <-waiterDone:
+	case <-time.After(time.Second):
+		t.Fatal("waiter was never released after the in-flight call panicked")
+	}
+
+	if waiterEntry.Status != statusInternalServerError {
+		t.Fatalf("expected waiter to get a 500 entry, got %+v", waiterEntry)
+	}
+}
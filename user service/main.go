@@ -2,40 +2,113 @@
 package main
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
-	"sync"
-)
 
-type User struct {
-	ID      int     `json:"id"`
-	Name    string  `json:"name"`
-	Email   string  `json:"email"`
-	Balance float64 `json:"balance"`
-}
+	_ "github.com/mattn/go-sqlite3"
+
+	"userservice/idempotency"
+	"userservice/storage"
+)
 
-var (
-	users      = make(map[int]User)
-	usersMutex sync.RWMutex
-	nextUserID = 1
+// defaultSQLDriver and defaultSQLDSN back STORAGE_BACKEND=sql out of
+// the box: a local SQLite file needs no external database to reach a
+// working persistent backend. STORAGE_SQL_DRIVER/STORAGE_DSN override
+// them; only the sqlite3 driver is imported here, and the SQL
+// repository's queries use SQLite syntax.
+const (
+	defaultSQLDriver = "sqlite3"
+	defaultSQLDSN    = "users.db"
 )
 
+// idempotencyCapacity bounds how many distinct Idempotency-Key
+// responses are cached at once.
+const idempotencyCapacity = 10000
+
+// balanceIdempotency caches updateBalanceHandler's response per
+// Idempotency-Key, so a retried balance update is answered without
+// debiting or crediting a user twice.
+var balanceIdempotency = idempotency.NewStore(idempotencyCapacity, idempotency.DefaultTTL)
+
+// User is re-exported from storage so handlers and request/response
+// bodies can keep referring to it as User.
+type User = storage.User
+
+// repo is the active UserRepository, selected once in main by
+// STORAGE_BACKEND. Handlers never touch storage state directly.
+var repo storage.UserRepository
+
 func main() {
-	usersMutex.Lock()
-	usersMutex.Unlock()
+	repo = newRepository()
 
 	http.HandleFunc("/users", createUserHandler)
 	http.HandleFunc("/users/", getUserHandler)
 	http.HandleFunc("/users/all", getAllUsersHandler)
 	http.HandleFunc("/users/check_balance", checkBalanceHandler)
 	http.HandleFunc("/users/update_balance", updateBalanceHandler)
+	http.HandleFunc("/users/escrow/hold", escrowHoldHandler)
+	http.HandleFunc("/users/escrow/release", escrowReleaseHandler)
+	http.HandleFunc("/users/escrow/capture", escrowCaptureHandler)
 
 	fmt.Println("User Service started on :8080")
 	http.ListenAndServe(":8080", nil)
 }
 
+// newRepository builds the UserRepository selected by STORAGE_BACKEND:
+// "sql" opens STORAGE_DSN with the driver named by STORAGE_SQL_DRIVER
+// (which must have been imported for its side effect elsewhere in the
+// build), anything else (including unset) keeps today's in-memory
+// behavior.
+func newRepository() storage.UserRepository {
+	if os.Getenv("STORAGE_BACKEND") != "sql" {
+		return storage.NewMemoryUserRepository()
+	}
+
+	driver := os.Getenv("STORAGE_SQL_DRIVER")
+	if driver == "" {
+		driver = defaultSQLDriver
+	}
+	dsn := os.Getenv("STORAGE_DSN")
+	if dsn == "" {
+		dsn = defaultSQLDSN
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		log.Fatalf("opening %s database: %v", driver, err)
+	}
+
+	sqlRepo, err := storage.NewSQLUserRepository(db)
+	if err != nil {
+		log.Fatalf("initializing SQL user repository: %v", err)
+	}
+
+	return sqlRepo
+}
+
+// writeRepoError maps a storage error to the HTTP response the handlers
+// already used to return for it.
+func writeRepoError(w http.ResponseWriter, err error) {
+	switch err {
+	case storage.ErrUserNotFound:
+		http.Error(w, "User not found", http.StatusNotFound)
+	case storage.ErrEmailInUse:
+		http.Error(w, "Email already in use", http.StatusConflict)
+	case storage.ErrInsufficientFunds:
+		http.Error(w, "Insufficient funds", http.StatusPaymentRequired)
+	case storage.ErrEscrowUnderflow:
+		http.Error(w, "Escrow underflow", http.StatusBadRequest)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
 func createUserHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -48,23 +121,15 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usersMutex.Lock()
-	defer usersMutex.Unlock()
-
-	for _, user := range users {
-		if user.Email == newUser.Email {
-			http.Error(w, "Email already in use", http.StatusConflict)
-			return
-		}
+	created, err := repo.CreateUser(newUser)
+	if err != nil {
+		writeRepoError(w, err)
+		return
 	}
 
-	newUser.ID = nextUserID
-	users[nextUserID] = newUser
-	nextUserID++
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(newUser)
+	json.NewEncoder(w).Encode(created)
 }
 
 func getUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -80,10 +145,11 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usersMutex.RLock()
-	user, exists := users[id]
-	usersMutex.RUnlock()
-
+	user, exists, err := repo.GetUser(id)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
 	if !exists {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
@@ -99,12 +165,13 @@ func getAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usersMutex.RLock()
-	defer usersMutex.RUnlock()
-
-	userList := make([]User, 0, len(users))
-	for _, user := range users {
-		userList = append(userList, user)
+	userList, err := repo.ListUsers()
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	if userList == nil {
+		userList = []User{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -120,10 +187,11 @@ func checkBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	userID, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
 	amount, _ := strconv.ParseFloat(r.URL.Query().Get("amount"), 64)
 
-	usersMutex.RLock()
-	user, exists := users[userID]
-	usersMutex.RUnlock()
-
+	user, exists, err := repo.GetUser(userID)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
 	if !exists {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
@@ -141,12 +209,34 @@ func checkBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// updateBalanceHandler enforces the Idempotency-Key contract around
+// updateBalance: a request carrying a key that's already cached is
+// answered from cache without updateBalance running again, and
+// concurrent requests sharing a key share a single updateBalance call
+// via balanceIdempotency.Do, so a client retry after a dropped response
+// (even one racing its own original request) never debits or credits a
+// user twice.
 func updateBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		updateBalance(w, r)
+		return
+	}
+
+	entry := balanceIdempotency.Do(key, func() idempotency.Entry {
+		rec := newResponseRecorder()
+		updateBalance(rec, r)
+		return rec.entry()
+	})
+	writeCachedResponse(w, entry)
+}
+
+func updateBalance(w http.ResponseWriter, r *http.Request) {
 	type BalanceUpdate struct {
 		UserID int     `json:"user_id"`
 		Amount float64 `json:"amount"`
@@ -158,23 +248,142 @@ func updateBalanceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usersMutex.Lock()
-	defer usersMutex.Unlock()
+	user, err := repo.UpdateBalance(update.UserID, update.Amount)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
 
-	user, exists := users[update.UserID]
-	if !exists {
-		http.Error(w, "User not found", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// responseRecorder buffers a handler's response so it can be cached
+// against its Idempotency-Key before being written to the real
+// http.ResponseWriter.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (rec *responseRecorder) Header() http.Header { return rec.header }
+
+func (rec *responseRecorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+
+func (rec *responseRecorder) WriteHeader(status int) { rec.status = status }
+
+func (rec *responseRecorder) entry() idempotency.Entry {
+	return idempotency.Entry{
+		Status:      rec.status,
+		ContentType: rec.header.Get("Content-Type"),
+		Body:        rec.body.Bytes(),
+	}
+}
+
+// writeCachedResponse replays a cached handler response verbatim.
+func writeCachedResponse(w http.ResponseWriter, entry idempotency.Entry) {
+	if entry.ContentType != "" {
+		w.Header().Set("Content-Type", entry.ContentType)
+	}
+	w.WriteHeader(entry.Status)
+	w.Write(entry.Body)
+}
+
+// EscrowRequest is the payload for holding or releasing funds against a
+// single user's escrow balance.
+type EscrowRequest struct {
+	UserID int     `json:"user_id"`
+	Amount float64 `json:"amount"`
+}
+
+// EscrowCaptureRequest moves a bidder's held funds into the seller's
+// balance once an auction settles.
+type EscrowCaptureRequest struct {
+	UserID   int     `json:"user_id"`
+	SellerID int     `json:"seller_id"`
+	Amount   float64 `json:"amount"`
+}
+
+// escrowHoldHandler moves funds from a user's spendable balance into
+// escrow so they can back a bid. It is the only place balance is
+// deducted for a bid; the auction service no longer debits directly.
+func escrowHoldHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EscrowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid escrow data", http.StatusBadRequest)
+		return
+	}
+
+	user, err := repo.HoldBalance(req.UserID, req.Amount)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// escrowReleaseHandler returns previously held funds to a user's
+// spendable balance, e.g. when they are outbid.
+func escrowReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if user.Balance+update.Amount < 0 {
-		http.Error(w, "Insufficient funds", http.StatusBadRequest)
+	var req EscrowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid escrow data", http.StatusBadRequest)
 		return
 	}
 
-	user.Balance += update.Amount
-	users[update.UserID] = user
+	user, err := repo.ReleaseHold(req.UserID, req.Amount)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
+
+// escrowCaptureHandler moves a winning bidder's held funds into the
+// seller's balance once an auction settles. The repository applies both
+// mutations atomically so the funds are never observed as missing from
+// both accounts at once.
+func escrowCaptureHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EscrowCaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid escrow data", http.StatusBadRequest)
+		return
+	}
+
+	seller, err := repo.CaptureEscrow(req.UserID, req.SellerID, req.Amount)
+	if err != nil {
+		if err == storage.ErrUserNotFound {
+			http.Error(w, "Bidder or seller not found", http.StatusNotFound)
+			return
+		}
+		writeRepoError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seller)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"userservice/idempotency"
+	"userservice/storage"
+)
+
+// TestUpdateBalanceHandlerDeduplicatesConcurrentRetries fires concurrent
+// duplicate PUT /users/update_balance requests sharing an
+// Idempotency-Key - the literal "client retry racing its own original
+// request" scenario - and asserts the user's balance reflects exactly
+// one debit, not one per request.
+func TestUpdateBalanceHandlerDeduplicatesConcurrentRetries(t *testing.T) {
+	repo = storage.NewMemoryUserRepository()
+	balanceIdempotency = idempotency.NewStore(idempotencyCapacity, idempotency.DefaultTTL)
+	user, err := repo.CreateUser(storage.User{Name: "Alice", Email: "alice@concurrent-test.example", Balance: 1000})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	const concurrency = 20
+	body := []byte(`{"user_id":` + strconv.Itoa(user.ID) + `,"amount":-100}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("PUT", "/users/update_balance", bytes.NewReader(body))
+			req.Header.Set("Idempotency-Key", "balance-retry-key")
+			rec := httptest.NewRecorder()
+			updateBalanceHandler(rec, req)
+		}()
+	}
+	wg.Wait()
+
+	got, exists, err := repo.GetUser(user.ID)
+	if err != nil || !exists {
+		t.Fatalf("GetUser after concurrent updates: exists=%v err=%v", exists, err)
+	}
+	if got.Balance != 900 {
+		t.Fatalf("expected exactly one debit of 100 (balance 900), got balance %v after %d concurrent duplicate requests", got.Balance, concurrency)
+	}
+}
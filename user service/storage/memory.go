@@ -0,0 +1,138 @@
+package storage
+
+import "sync"
+
+// MemoryUserRepository is the original in-process map-backed store,
+// wrapped behind UserRepository so it's a drop-in alternative to a SQL
+// backend. All state is lost on restart.
+type MemoryUserRepository struct {
+	mu         sync.Mutex
+	users      map[int]User
+	nextUserID int
+}
+
+// NewMemoryUserRepository returns an empty in-memory repository.
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:      make(map[int]User),
+		nextUserID: 1,
+	}
+}
+
+func (r *MemoryUserRepository) CreateUser(user User) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return User{}, ErrEmailInUse
+		}
+	}
+
+	user.ID = r.nextUserID
+	r.users[user.ID] = user
+	r.nextUserID++
+
+	return user, nil
+}
+
+func (r *MemoryUserRepository) GetUser(id int) (User, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.users[id]
+	return user, exists, nil
+}
+
+func (r *MemoryUserRepository) ListUsers() ([]User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]User, 0, len(r.users))
+	for _, user := range r.users {
+		list = append(list, user)
+	}
+	return list, nil
+}
+
+func (r *MemoryUserRepository) UpdateBalance(userID int, delta float64) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.users[userID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+
+	if user.Balance+delta < 0 {
+		return User{}, ErrInsufficientFunds
+	}
+
+	user.Balance += delta
+	r.users[userID] = user
+	return user, nil
+}
+
+func (r *MemoryUserRepository) HoldBalance(userID int, amount float64) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.users[userID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+
+	if user.Balance < amount {
+		return User{}, ErrInsufficientFunds
+	}
+
+	user.Balance -= amount
+	user.Escrowed += amount
+	r.users[userID] = user
+	return user, nil
+}
+
+func (r *MemoryUserRepository) ReleaseHold(userID int, amount float64) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.users[userID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+
+	if user.Escrowed < amount {
+		return User{}, ErrEscrowUnderflow
+	}
+
+	user.Escrowed -= amount
+	user.Balance += amount
+	r.users[userID] = user
+	return user, nil
+}
+
+func (r *MemoryUserRepository) CaptureEscrow(bidderID, sellerID int, amount float64) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bidder, exists := r.users[bidderID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+
+	seller, exists := r.users[sellerID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+
+	if bidder.Escrowed < amount {
+		return User{}, ErrEscrowUnderflow
+	}
+
+	bidder.Escrowed -= amount
+	seller.Balance += amount
+	r.users[bidderID] = bidder
+	r.users[sellerID] = seller
+
+	return seller, nil
+}
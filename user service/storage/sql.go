@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SQLUserRepository is a database/sql-backed UserRepository over an
+// *sql.DB opened by the caller. Its schema and queries use SQLite
+// syntax (AUTOINCREMENT, "?" placeholders, LastInsertId), so drivers
+// for other SQL dialects such as Postgres do not work with it. This
+// package only depends on the standard library, so the driver itself
+// must be imported for its side effect wherever the binary selects
+// STORAGE_BACKEND=sql.
+type SQLUserRepository struct {
+	db *sql.DB
+}
+
+// NewSQLUserRepository wraps an already-opened *sql.DB and ensures the
+// users table exists.
+func NewSQLUserRepository(db *sql.DB) (*SQLUserRepository, error) {
+	const schema = `
+CREATE TABLE IF NOT EXISTS users (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	name     TEXT NOT NULL,
+	email    TEXT NOT NULL UNIQUE,
+	balance  REAL NOT NULL DEFAULT 0,
+	escrowed REAL NOT NULL DEFAULT 0,
+	version  INTEGER NOT NULL DEFAULT 0
+);`
+
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("creating users table: %w", err)
+	}
+
+	return &SQLUserRepository{db: db}, nil
+}
+
+func (r *SQLUserRepository) CreateUser(user User) (User, error) {
+	res, err := r.db.Exec(
+		"INSERT INTO users (name, email, balance, escrowed) VALUES (?, ?, ?, ?)",
+		user.Name, user.Email, user.Balance, user.Escrowed,
+	)
+	if err != nil {
+		return User{}, ErrEmailInUse
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return User{}, err
+	}
+
+	user.ID = int(id)
+	return user, nil
+}
+
+func (r *SQLUserRepository) GetUser(id int) (User, bool, error) {
+	return scanUser(r.db.QueryRow(
+		"SELECT id, name, email, balance, escrowed FROM users WHERE id = ?", id,
+	))
+}
+
+func (r *SQLUserRepository) ListUsers() ([]User, error) {
+	rows, err := r.db.Query("SELECT id, name, email, balance, escrowed FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Balance, &u.Escrowed); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *SQLUserRepository) UpdateBalance(userID int, delta float64) (User, error) {
+	return r.withUserTx(userID, func(tx *sql.Tx, user User) (User, error) {
+		if user.Balance+delta < 0 {
+			return User{}, ErrInsufficientFunds
+		}
+		user.Balance += delta
+		return user, nil
+	})
+}
+
+func (r *SQLUserRepository) HoldBalance(userID int, amount float64) (User, error) {
+	return r.withUserTx(userID, func(tx *sql.Tx, user User) (User, error) {
+		if user.Balance < amount {
+			return User{}, ErrInsufficientFunds
+		}
+		user.Balance -= amount
+		user.Escrowed += amount
+		return user, nil
+	})
+}
+
+func (r *SQLUserRepository) ReleaseHold(userID int, amount float64) (User, error) {
+	return r.withUserTx(userID, func(tx *sql.Tx, user User) (User, error) {
+		if user.Escrowed < amount {
+			return User{}, ErrEscrowUnderflow
+		}
+		user.Escrowed -= amount
+		user.Balance += amount
+		return user, nil
+	})
+}
+
+// maxCASRetries bounds how many times withUserTx/CaptureEscrow retry
+// after losing a compare-and-swap race against another writer, before
+// giving up.
+const maxCASRetries = 10
+
+// CaptureEscrow moves amount from the bidder's escrow into the
+// seller's balance inside a single transaction, so the funds are never
+// durably missing from both accounts at once.
+func (r *SQLUserRepository) CaptureEscrow(bidderID, sellerID int, amount float64) (User, error) {
+	for attempt := 0; attempt < maxCASRetries; attempt++ {
+		seller, ok, err := r.tryCaptureEscrow(bidderID, sellerID, amount)
+		if err != nil || ok {
+			return seller, err
+		}
+	}
+	return User{}, fmt.Errorf("users %d/%d: exceeded %d retries racing concurrent updates", bidderID, sellerID, maxCASRetries)
+}
+
+func (r *SQLUserRepository) tryCaptureEscrow(bidderID, sellerID int, amount float64) (_ User, ok bool, _ error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return User{}, false, err
+	}
+	defer tx.Rollback()
+
+	var bidderVersion, sellerVersion int64
+
+	bidder, found, err := scanUser(tx.QueryRow(
+		"SELECT id, name, email, balance, escrowed, version FROM users WHERE id = ?", bidderID,
+	), &bidderVersion)
+	if err != nil {
+		return User{}, false, err
+	}
+	if !found {
+		return User{}, false, ErrUserNotFound
+	}
+
+	seller, found, err := scanUser(tx.QueryRow(
+		"SELECT id, name, email, balance, escrowed, version FROM users WHERE id = ?", sellerID,
+	), &sellerVersion)
+	if err != nil {
+		return User{}, false, err
+	}
+	if !found {
+		return User{}, false, ErrUserNotFound
+	}
+
+	if bidder.Escrowed < amount {
+		return User{}, false, ErrEscrowUnderflow
+	}
+
+	bidder.Escrowed -= amount
+	seller.Balance += amount
+
+	if ok, err := saveUser(tx, bidder, bidderVersion); err != nil {
+		return User{}, false, err
+	} else if !ok {
+		return User{}, false, nil
+	}
+	if ok, err := saveUser(tx, seller, sellerVersion); err != nil {
+		return User{}, false, err
+	} else if !ok {
+		return User{}, false, nil
+	}
+
+	return seller, true, tx.Commit()
+}
+
+// withUserTx loads userID alongside its version counter, applies fn,
+// and writes the result back gated on that version being unchanged
+// (`UPDATE ... WHERE id = ? AND version = ?`), retrying against a
+// fresh read if another writer won the race. A plain SELECT then
+// UPDATE inside a transaction isn't enough on READ COMMITTED engines
+// like Postgres: two concurrent transactions can both read the same
+// row and both commit their write, silently losing one of them.
+func (r *SQLUserRepository) withUserTx(userID int, fn func(tx *sql.Tx, user User) (User, error)) (User, error) {
+	for attempt := 0; attempt < maxCASRetries; attempt++ {
+		updated, ok, err := r.tryWithUserTx(userID, fn)
+		if err != nil || ok {
+			return updated, err
+		}
+	}
+	return User{}, fmt.Errorf("user %d: exceeded %d retries racing concurrent updates", userID, maxCASRetries)
+}
+
+func (r *SQLUserRepository) tryWithUserTx(userID int, fn func(tx *sql.Tx, user User) (User, error)) (_ User, ok bool, _ error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return User{}, false, err
+	}
+	defer tx.Rollback()
+
+	var version int64
+	user, found, err := scanUser(tx.QueryRow(
+		"SELECT id, name, email, balance, escrowed, version FROM users WHERE id = ?", userID,
+	), &version)
+	if err != nil {
+		return User{}, false, err
+	}
+	if !found {
+		return User{}, false, ErrUserNotFound
+	}
+
+	updated, err := fn(tx, user)
+	if err != nil {
+		return User{}, false, err
+	}
+
+	saved, err := saveUser(tx, updated, version)
+	if err != nil {
+		return User{}, false, err
+	}
+	if !saved {
+		return User{}, false, nil
+	}
+
+	return updated, true, tx.Commit()
+}
+
+// saveUser writes user's mutable fields back, gated on version still
+// matching what was read. ok is false when another writer raced ahead
+// of us and the caller should retry against a fresh read.
+func saveUser(tx *sql.Tx, user User, version int64) (ok bool, err error) {
+	res, err := tx.Exec(
+		"UPDATE users SET balance = ?, escrowed = ?, version = version + 1 WHERE id = ? AND version = ?",
+		user.Balance, user.Escrowed, user.ID, version,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans one user row, reporting found=false instead of an
+// error when the row doesn't exist. extraDest, if given, receives any
+// columns selected after escrowed (e.g. version) in the order they
+// appear in the query.
+func scanUser(row rowScanner, extraDest ...interface{}) (User, bool, error) {
+	var u User
+	dest := append([]interface{}{&u.ID, &u.Name, &u.Email, &u.Balance, &u.Escrowed}, extraDest...)
+
+	err := row.Scan(dest...)
+	if err == sql.ErrNoRows {
+		return User{}, false, nil
+	}
+	if err != nil {
+		return User{}, false, err
+	}
+	return u, true, nil
+}
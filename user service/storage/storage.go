@@ -0,0 +1,47 @@
+// Package storage defines the persistence boundary for the User
+// Service. Handlers depend only on the UserRepository interface so the
+// backing store (in-memory today, a SQL database when STORAGE_BACKEND
+// asks for it) can be swapped without touching handler code.
+package storage
+
+import "errors"
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrEmailInUse        = errors.New("email already in use")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrEscrowUnderflow   = errors.New("escrow underflow")
+)
+
+// User is the persisted account record. Balance is spendable funds;
+// Escrowed is funds held against an outstanding bid.
+type User struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	Email    string  `json:"email"`
+	Balance  float64 `json:"balance"`
+	Escrowed float64 `json:"escrowed"`
+}
+
+// UserRepository is the full set of operations the User Service needs
+// against user accounts. Every balance-mutating method is expected to
+// apply atomically with respect to concurrent calls for the same user.
+type UserRepository interface {
+	CreateUser(user User) (User, error)
+	GetUser(id int) (User, bool, error)
+	ListUsers() ([]User, error)
+
+	// UpdateBalance applies delta to a user's spendable balance,
+	// rejecting the change if it would go negative.
+	UpdateBalance(userID int, delta float64) (User, error)
+
+	// HoldBalance moves amount from spendable balance into escrow.
+	HoldBalance(userID int, amount float64) (User, error)
+
+	// ReleaseHold moves amount from escrow back to spendable balance.
+	ReleaseHold(userID int, amount float64) (User, error)
+
+	// CaptureEscrow moves amount out of bidderID's escrow and into
+	// sellerID's spendable balance as a single atomic unit.
+	CaptureEscrow(bidderID, sellerID int, amount float64) (User, error)
+}